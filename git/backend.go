@@ -0,0 +1,118 @@
+package git
+
+import "context"
+
+// Backend is the set of git operations the package needs in order to
+// maintain a mirror and working clones of it. The default
+// implementation shells out to the `git` binary on PATH; goGitBackend
+// performs the same operations in-process using go-git, for use in
+// environments without a `git` binary, or to avoid fork/exec overhead
+// when syncing many repos frequently.
+type Backend interface {
+	Clone(ctx context.Context, dir, repoURL, branch string, partial PartialCloneMode) error
+	Fetch(ctx context.Context, dir, repoURL string, refspecs ...string) error
+	Checkout(ctx context.Context, dir, ref string) error
+	Commit(ctx context.Context, dir string, commitAction CommitAction) error
+	Push(ctx context.Context, dir, repoURL string, refs []string) error
+	AddNote(ctx context.Context, dir, rev, notesRef string, note interface{}) error
+	GetNote(ctx context.Context, dir, notesRef, rev string, note interface{}) (bool, error)
+	RefRevision(ctx context.Context, dir, ref string) (string, error)
+	ChangedFiles(ctx context.Context, dir, ref string, subPaths []string) ([]string, error)
+	Revert(ctx context.Context, dir string, action RevertAction) error
+	VerifyRevision(ctx context.Context, dir, rev string) (SignatureInfo, error)
+	SetUserConfig(ctx context.Context, dir, userName, userEmail string) error
+	SecretUnseal(ctx context.Context, dir string) error
+	Add(ctx context.Context, dir, path string) error
+	Check(ctx context.Context, dir string, subPaths []string, addUntracked bool) bool
+	MoveTagAndPush(ctx context.Context, dir, repoURL string, tagAction TagAction) error
+}
+
+// defaultBackend is used by Repo and Checkout when Config.Backend is nil.
+var defaultBackend Backend = execBackend{}
+
+// backend returns the Backend configured on c, or defaultBackend if
+// none was given.
+func (c Config) backend() Backend {
+	if c.Backend != nil {
+		return c.Backend
+	}
+	return defaultBackend
+}
+
+// execBackend is the original Backend, implemented by shelling out to
+// `git`. It is kept as the default since it is the most
+// battle-tested, and supports git features (e.g., notes, gitsecret)
+// that go-git does not.
+type execBackend struct{}
+
+func (execBackend) Clone(ctx context.Context, dir, repoURL, branch string, partial PartialCloneMode) error {
+	if partial != PartialCloneNone {
+		return clonePartial(ctx, dir, repoURL, branch, partial)
+	}
+	return clone(ctx, dir, repoURL, branch)
+}
+
+func (execBackend) Fetch(ctx context.Context, dir, repoURL string, refspecs ...string) error {
+	for _, refspec := range refspecs {
+		if err := fetch(ctx, dir, repoURL, refspec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (execBackend) Checkout(ctx context.Context, dir, ref string) error {
+	return checkout(ctx, dir, ref)
+}
+
+func (execBackend) Commit(ctx context.Context, dir string, commitAction CommitAction) error {
+	return commit(ctx, dir, commitAction)
+}
+
+func (execBackend) Push(ctx context.Context, dir, repoURL string, refs []string) error {
+	return push(ctx, dir, repoURL, refs)
+}
+
+func (execBackend) AddNote(ctx context.Context, dir, rev, notesRef string, note interface{}) error {
+	return addNote(ctx, dir, rev, notesRef, note)
+}
+
+func (execBackend) GetNote(ctx context.Context, dir, notesRef, rev string, note interface{}) (bool, error) {
+	return getNote(ctx, dir, notesRef, rev, note)
+}
+
+func (execBackend) RefRevision(ctx context.Context, dir, ref string) (string, error) {
+	return refRevision(ctx, dir, ref)
+}
+
+func (execBackend) ChangedFiles(ctx context.Context, dir, ref string, subPaths []string) ([]string, error) {
+	return changed(ctx, dir, ref, subPaths)
+}
+
+func (execBackend) Revert(ctx context.Context, dir string, action RevertAction) error {
+	return revert(ctx, dir, action)
+}
+
+func (execBackend) VerifyRevision(ctx context.Context, dir, rev string) (SignatureInfo, error) {
+	return verifyRevision(ctx, dir, rev)
+}
+
+func (execBackend) SetUserConfig(ctx context.Context, dir, userName, userEmail string) error {
+	return config(ctx, dir, userName, userEmail)
+}
+
+func (execBackend) SecretUnseal(ctx context.Context, dir string) error {
+	return secretUnseal(ctx, dir)
+}
+
+func (execBackend) Add(ctx context.Context, dir, path string) error {
+	return add(ctx, dir, path)
+}
+
+func (execBackend) Check(ctx context.Context, dir string, subPaths []string, addUntracked bool) bool {
+	return check(ctx, dir, subPaths, addUntracked)
+}
+
+func (execBackend) MoveTagAndPush(ctx context.Context, dir, repoURL string, tagAction TagAction) error {
+	return moveTagAndPush(ctx, dir, repoURL, tagAction)
+}
@@ -0,0 +1,34 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runGit runs `git <args...>`, with its working directory set to dir
+// (unless dir is empty, e.g. for a clone into a not-yet-existing
+// directory), and returns trimmed stdout on success or an error
+// wrapping git's stderr on failure.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	return runCmd(ctx, dir, "git", args...)
+}
+
+// runCmd runs `name <args...>`, with its working directory set to dir
+// (unless dir is empty), and returns trimmed stdout on success or an
+// error wrapping the command's stderr on failure.
+func runCmd(ctx context.Context, dir, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,366 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// errNotesUnsupported is returned by goGitBackend for the note
+// operations, which go-git has no equivalent for; callers that need
+// notes should use execBackend (the default) instead.
+var errNotesUnsupported = errors.New("git notes are not supported by the go-git backend")
+
+// errRevertUnsupported is returned by goGitBackend.Revert, since
+// go-git has no equivalent of `git revert`; callers that need to
+// revert commits should use execBackend (the default) instead.
+var errRevertUnsupported = errors.New("git revert is not supported by the go-git backend")
+
+// errPartialCloneUnsupported is returned by goGitBackend.Clone when
+// asked for a partial clone: go-git's CloneOptions has no filter
+// support, so callers that need Config.PartialClone should use
+// execBackend (the default) instead.
+var errPartialCloneUnsupported = errors.New("partial clone is not supported by the go-git backend")
+
+// errSigningUnsupported is returned by goGitBackend.Commit when asked
+// to sign a commit: go-git can sign given a private key, but we have
+// no way to turn a gpg.signingKey *name* (as configured for the exec
+// backend) into key material here. Callers that need signed commits
+// should use execBackend (the default) instead.
+var errSigningUnsupported = errors.New("signing commits is not supported by the go-git backend")
+
+// errSecretUnsealUnsupported is returned by goGitBackend.SecretUnseal,
+// since git-secret is a third-party tool that shells out to `git`
+// itself; callers that need it should use execBackend (the default)
+// instead.
+var errSecretUnsealUnsupported = errors.New("git-secret is not supported by the go-git backend")
+
+// goGitBackend implements Backend in-process with go-git, rather than
+// shelling out to a `git` binary. It trades support for some
+// less-common git features (notes, gitsecret) for the ability to run
+// without a `git` binary on PATH, and to avoid fork/exec overhead when
+// syncing a large number of repos.
+type goGitBackend struct{}
+
+// NewGoGitBackend returns a Backend that performs git operations
+// in-process with go-git, for assigning to Config.Backend.
+func NewGoGitBackend() Backend {
+	return goGitBackend{}
+}
+
+func (goGitBackend) Clone(ctx context.Context, dir, repoURL, branch string, partial PartialCloneMode) error {
+	if partial != PartialCloneNone {
+		return errPartialCloneUnsupported
+	}
+	opts := &git.CloneOptions{URL: repoURL}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	}
+	_, err := git.PlainCloneContext(ctx, dir, false, opts)
+	return err
+}
+
+func (goGitBackend) Fetch(ctx context.Context, dir, repoURL string, refspecs ...string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	specs := make([]gitconfig.RefSpec, len(refspecs))
+	for i, s := range refspecs {
+		specs[i] = gitconfig.RefSpec(s)
+	}
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteURL: repoURL,
+		RefSpecs:  specs,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func (goGitBackend) Checkout(ctx context.Context, dir, ref string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return err
+	}
+	return wt.Checkout(&git.CheckoutOptions{Hash: *hash})
+}
+
+func (goGitBackend) Commit(ctx context.Context, dir string, commitAction CommitAction) error {
+	if commitAction.SigningKey != "" {
+		return errSigningUnsupported
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	opts := &git.CommitOptions{}
+	if commitAction.Author != "" {
+		name, email, err := splitAuthor(commitAction.Author)
+		if err != nil {
+			return err
+		}
+		// Only set Author when we have one: go-git uses a non-nil
+		// Author as-is, with no fallback to repo config or time.Now(),
+		// so an incomplete Signature would commit with a blank email
+		// and a zero timestamp.
+		opts.Author = &object.Signature{Name: name, Email: email, When: time.Now()}
+	}
+
+	_, err = wt.Commit(commitAction.Message, opts)
+	return err
+}
+
+// splitAuthor parses a "Name <email>" author string, the format
+// CommitAction.Author is given in, into its parts.
+func splitAuthor(author string) (name, email string, err error) {
+	addr, err := mail.ParseAddress(author)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing author %q: %w", author, err)
+	}
+	return addr.Name, addr.Address, nil
+}
+
+func (goGitBackend) Push(ctx context.Context, dir, repoURL string, refs []string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	specs := make([]gitconfig.RefSpec, len(refs))
+	for i, r := range refs {
+		specs[i] = gitconfig.RefSpec(r + ":" + r)
+	}
+	err = repo.PushContext(ctx, &git.PushOptions{
+		RemoteURL: repoURL,
+		RefSpecs:  specs,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func (goGitBackend) AddNote(ctx context.Context, dir, rev, notesRef string, note interface{}) error {
+	return errNotesUnsupported
+}
+
+func (goGitBackend) GetNote(ctx context.Context, dir, notesRef, rev string, note interface{}) (bool, error) {
+	return false, errNotesUnsupported
+}
+
+func (goGitBackend) RefRevision(ctx context.Context, dir, ref string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+func (goGitBackend) ChangedFiles(ctx context.Context, dir, ref string, subPaths []string) ([]string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.ResolveRevision(plumbing.Revision("HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	from, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := repo.CommitObject(*head)
+	if err != nil {
+		return nil, err
+	}
+	fromCommit, err := repo.CommitObject(*from)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := fromTree.Diff(headTree)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, c := range changes {
+		// Only files present at HEAD are listed; a deleted file has
+		// no name on the HEAD side.
+		if c.To.Name == "" {
+			continue
+		}
+		if withinPaths(c.To.Name, subPaths) || withinPaths(c.From.Name, subPaths) {
+			files = append(files, c.To.Name)
+		}
+	}
+	return files, nil
+}
+
+func (goGitBackend) Revert(ctx context.Context, dir string, action RevertAction) error {
+	return errRevertUnsupported
+}
+
+func (goGitBackend) VerifyRevision(ctx context.Context, dir, rev string) (SignatureInfo, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return SignatureInfo{}, err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return SignatureInfo{}, err
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return SignatureInfo{}, err
+	}
+	if commit.PGPSignature == "" {
+		return SignatureInfo{}, nil
+	}
+	// go-git's Commit.Verify needs the armored keyring contents, which
+	// this backend is not given, so a signed commit is not verified
+	// here: it is reported as an error. An unsigned commit yields a
+	// zero SignatureInfo (Valid false) and no error.
+	return SignatureInfo{}, errors.New("verifying signatures requires a loaded GPG keyring, which the go-git backend does not yet accept")
+}
+
+func (goGitBackend) SetUserConfig(ctx context.Context, dir, userName, userEmail string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg.User.Name = userName
+	cfg.User.Email = userEmail
+	return repo.SetConfig(cfg)
+}
+
+func (goGitBackend) SecretUnseal(ctx context.Context, dir string) error {
+	return errSecretUnsealUnsupported
+}
+
+func (goGitBackend) Add(ctx context.Context, dir, path string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Add(path)
+	return err
+}
+
+func (goGitBackend) Check(ctx context.Context, dir string, subPaths []string, addUntracked bool) bool {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return false
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return false
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return false
+	}
+	for file, s := range status {
+		if s.Worktree == git.Unmodified && s.Staging == git.Unmodified {
+			continue
+		}
+		if !addUntracked && s.Staging == git.Untracked {
+			continue
+		}
+		if withinPaths(file, subPaths) {
+			return true
+		}
+	}
+	return false
+}
+
+// MoveTagAndPush deletes tagAction.Tag if it already exists, recreates
+// it at tagAction.Revision, and force-pushes it upstream.
+func (goGitBackend) MoveTagAndPush(ctx context.Context, dir, repoURL string, tagAction TagAction) error {
+	if tagAction.SigningKey != "" {
+		return errSigningUnsupported
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(tagAction.Revision))
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeleteTag(tagAction.Tag); err != nil && err != git.ErrTagNotFound {
+		return err
+	}
+
+	if _, err := repo.CreateTag(tagAction.Tag, *hash, &git.CreateTagOptions{Message: tagAction.Message}); err != nil {
+		return err
+	}
+
+	refspec := gitconfig.RefSpec("+refs/tags/" + tagAction.Tag + ":refs/tags/" + tagAction.Tag)
+	err = repo.PushContext(ctx, &git.PushOptions{
+		RemoteURL: repoURL,
+		RefSpecs:  []gitconfig.RefSpec{refspec},
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+// withinPaths reports whether name is under one of paths, or paths is
+// empty (meaning "the whole repo is of interest").
+func withinPaths(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const maxAppendNoteEventRetries = 5
+
+// ErrNoteConflict is returned by AppendNoteEvent when a concurrent
+// update to the same note could not be reconciled after retrying.
+var ErrNoteConflict = errors.New("concurrent update to note, giving up after retries")
+
+// SyncEvent is a single record in the append-only event log Flux
+// keeps per revision, describing one thing it did with or to that
+// revision -- a sync, an apply, a rollback, and so on.
+type SyncEvent struct {
+	Timestamp time.Time
+	Actor     string
+	Action    string
+	Outcome   string
+	Details   string
+}
+
+// AppendNoteEvent appends event to the ordered log of SyncEvents held
+// in the note for rev, creating the note if there isn't one yet. It
+// reads the existing note, appends, and writes it back, retrying on a
+// concurrent update to the same note.
+func (c *Checkout) AppendNoteEvent(ctx context.Context, rev string, event SyncEvent) error {
+	for attempt := 0; attempt < maxAppendNoteEventRetries; attempt++ {
+		// Take the precondition before reading the note, so that an
+		// update landing in between is caught by addNoteCAS.
+		precondition, err := noteBlobHash(ctx, c.Dir(), c.realNotesRef, rev)
+		if err != nil {
+			return err
+		}
+
+		var events []SyncEvent
+		if _, err := c.GetNote(ctx, rev, &events); err != nil {
+			return err
+		}
+
+		events = append(events, event)
+		err = addNoteCAS(ctx, c.Dir(), rev, c.realNotesRef, events, precondition)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, ErrNoteConflict):
+			continue
+		default:
+			return err
+		}
+	}
+	return ErrNoteConflict
+}
+
+// ListNoteEvents returns the ordered log of SyncEvents held in the
+// note for rev, or nil if there is no such note.
+func (c *Checkout) ListNoteEvents(ctx context.Context, rev string) ([]SyncEvent, error) {
+	var events []SyncEvent
+	if _, err := c.GetNote(ctx, rev, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// noteBlobHash returns the object hash of the note blob attached to
+// rev under notesRef, or "" if there is no such note. It's used as an
+// optimistic-concurrency precondition by addNoteCAS.
+func noteBlobHash(ctx context.Context, dir, notesRef, rev string) (string, error) {
+	out, err := runGit(ctx, dir, "notes", "--ref="+notesRef, "list", rev)
+	if err != nil {
+		if strings.Contains(err.Error(), "no note found") {
+			return "", nil
+		}
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+// addNoteCAS JSON-encodes note and writes it as the note for rev under
+// notesRef, but only if the note's current blob hash still matches
+// precondition (as returned by a prior noteBlobHash) -- otherwise it
+// returns ErrNoteConflict, without writing anything.
+func addNoteCAS(ctx context.Context, dir, rev, notesRef string, note interface{}, precondition string) error {
+	current, err := noteBlobHash(ctx, dir, notesRef, rev)
+	if err != nil {
+		return err
+	}
+	if current != precondition {
+		return ErrNoteConflict
+	}
+
+	data, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(ctx, dir, "notes", "--ref="+notesRef, "add", "-f", "-m", string(data), rev)
+	return err
+}
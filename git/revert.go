@@ -0,0 +1,118 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// RevertAction describes a `git revert` to be performed and pushed by
+// (*Checkout).RevertAndPush.
+type RevertAction struct {
+	Revisions  []string // revisions to revert, in the order `git revert` should apply them
+	Mainline   int      // parent number to diff against when reverting a merge commit; 0 for a non-merge commit
+	Message    string   // when non-empty, overrides the default "Revert ..." message of the last revert commit made
+	SigningKey string
+}
+
+// ErrRevertConflict is returned from Revert and RevertAndPush when `git
+// revert` stops because of a conflict that needs a human to resolve.
+type ErrRevertConflict struct {
+	Revisions []string
+	Err       error
+}
+
+func (e ErrRevertConflict) Error() string {
+	return fmt.Sprintf("conflict reverting %v: %s", e.Revisions, e.Err)
+}
+
+// Revert runs `git revert --no-edit` for the revisions named in the
+// action, signing the resulting commit with the action's SigningKey, or
+// failing that, the checkout's configured SigningKey. Only an actual
+// merge conflict is reported as ErrRevertConflict; any other failure
+// (a bad revision, a signing failure, a cancelled context, ...) is
+// returned as-is.
+func (c *Checkout) Revert(ctx context.Context, action RevertAction) error {
+	if action.SigningKey == "" {
+		action.SigningKey = c.config.SigningKey
+	}
+	err := c.config.backend().Revert(ctx, c.Dir(), action)
+	if err == nil {
+		return nil
+	}
+	var conflict errGitRevertConflict
+	if errors.As(err, &conflict) {
+		return ErrRevertConflict{Revisions: action.Revisions, Err: conflict.err}
+	}
+	return err
+}
+
+// RevertAndPush reverts the revisions named in the action, then pushes
+// the resulting commit to the upstream branch, via the same push path
+// as CommitAndPush.
+func (c *Checkout) RevertAndPush(ctx context.Context, action RevertAction) error {
+	if err := c.Revert(ctx, action); err != nil {
+		return err
+	}
+
+	refs, err := c.pushRefSpecs(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.config.backend().Push(ctx, c.Dir(), c.upstream.URL, refs); err != nil {
+		return PushError(c.upstream.URL, err)
+	}
+	return nil
+}
+
+// errGitRevertConflict marks an error from the low-level revert as a
+// genuine merge conflict left for a human to resolve, as opposed to
+// any other failure (a bad revision, a signing failure, a cancelled
+// context, ...), which should be reported to the caller unchanged.
+type errGitRevertConflict struct{ err error }
+
+func (e errGitRevertConflict) Error() string { return e.err.Error() }
+func (e errGitRevertConflict) Unwrap() error { return e.err }
+
+// revert is execBackend's implementation of Backend.Revert. It runs
+// `git revert --no-edit -m <mainline> -S<key> <revisions...>`, then,
+// if action.Message overrides the default message, amends the last
+// resulting commit (one commit is made per revision) to use it.
+func revert(ctx context.Context, dir string, action RevertAction) error {
+	args := []string{"revert", "--no-edit"}
+	if action.Mainline > 0 {
+		args = append(args, "-m", strconv.Itoa(action.Mainline))
+	}
+	if action.SigningKey != "" {
+		args = append(args, "-S"+action.SigningKey)
+	}
+	args = append(args, action.Revisions...)
+
+	if _, err := runGit(ctx, dir, args...); err != nil {
+		if isRevertConflict(ctx, dir) {
+			return errGitRevertConflict{err}
+		}
+		return err
+	}
+
+	if action.Message == "" {
+		return nil
+	}
+
+	amendArgs := []string{"commit", "--amend", "-m", action.Message}
+	if action.SigningKey != "" {
+		amendArgs = append(amendArgs, "-S"+action.SigningKey)
+	}
+	_, err := runGit(ctx, dir, amendArgs...)
+	return err
+}
+
+// isRevertConflict reports whether a failed `git revert` left the
+// working tree mid-revert, i.e. stopped because of a conflict rather
+// than failing outright.
+func isRevertConflict(ctx context.Context, dir string) bool {
+	_, err := runGit(ctx, dir, "rev-parse", "--verify", "-q", "REVERT_HEAD")
+	return err == nil
+}
@@ -0,0 +1,47 @@
+package git
+
+import "context"
+
+// PartialCloneMode selects what a working clone made with
+// Config.PartialClone fetches eagerly, trading completeness of the
+// local object database for a much smaller/faster clone.
+type PartialCloneMode string
+
+const (
+	// PartialCloneNone performs a full clone (the default).
+	PartialCloneNone PartialCloneMode = ""
+	// PartialCloneBlobless fetches commits and trees eagerly, but
+	// blobs lazily on demand (`--filter=blob:none`).
+	PartialCloneBlobless PartialCloneMode = "blob:none"
+	// PartialCloneTreeless fetches only commits eagerly, with trees
+	// and blobs lazily on demand (`--filter=tree:0`).
+	PartialCloneTreeless PartialCloneMode = "tree:0"
+)
+
+// clonePartial performs `git clone --filter=<filter> --no-checkout`,
+// optionally pinned to branch, into dir (which must exist and be
+// empty). It's used for Config.PartialClone, so a sparse checkout
+// doesn't require every blob in a large monorepo to be fetched first.
+func clonePartial(ctx context.Context, dir, repoURL, branch string, filter PartialCloneMode) error {
+	args := []string{"clone", "--filter=" + string(filter), "--no-checkout"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	args = append(args, repoURL, dir)
+	_, err := runGit(ctx, "", args...)
+	return err
+}
+
+// sparseCheckoutInit runs `git sparse-checkout init --cone` in dir.
+func sparseCheckoutInit(ctx context.Context, dir string) error {
+	_, err := runGit(ctx, dir, "sparse-checkout", "init", "--cone")
+	return err
+}
+
+// sparseCheckoutSet runs `git sparse-checkout set <paths...>` in dir,
+// restricting the working tree to the given cone of paths.
+func sparseCheckoutSet(ctx context.Context, dir string, paths []string) error {
+	args := append([]string{"sparse-checkout", "set"}, paths...)
+	_, err := runGit(ctx, dir, args...)
+	return err
+}
@@ -0,0 +1,154 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SignaturePolicy determines how Repo.Clone treats signature
+// verification of the revision it checks out.
+type SignaturePolicy string
+
+const (
+	// SignaturesNone does not attempt verification (the default).
+	SignaturesNone SignaturePolicy = "none"
+	// SignaturesOptional verifies the revision if possible, but does
+	// not fail Clone when verification fails or no signature exists.
+	SignaturesOptional SignaturePolicy = "optional"
+	// SignaturesRequired fails Clone unless the checked-out revision
+	// has a valid signature.
+	SignaturesRequired SignaturePolicy = "required"
+)
+
+// SignatureInfo is the parsed result of `git verify-commit` or `git
+// verify-tag`.
+type SignatureInfo struct {
+	Signer string
+	KeyID  string
+	Trust  string
+	Valid  bool
+}
+
+// ErrSignatureVerificationFailed is returned by Clone and
+// MoveTagAndPush when Config.VerifySignatures is SignaturesRequired
+// and a revision's signature does not verify.
+var ErrSignatureVerificationFailed = errors.New("signature verification failed")
+
+// VerifyRevision runs `git verify-commit` against rev, falling back to
+// `git verify-tag` if rev names an annotated tag, and parses the
+// result into a SignatureInfo.
+func (c *Checkout) VerifyRevision(ctx context.Context, rev string) (SignatureInfo, error) {
+	return c.config.backend().VerifyRevision(ctx, c.Dir(), rev)
+}
+
+// verifyRevision is execBackend's implementation of Backend.VerifyRevision.
+func verifyRevision(ctx context.Context, dir, rev string) (SignatureInfo, error) {
+	objType, err := runGit(ctx, dir, "cat-file", "-t", rev)
+	if err != nil {
+		return SignatureInfo{}, err
+	}
+
+	verb := "verify-commit"
+	if objType == "tag" {
+		verb = "verify-tag"
+	}
+
+	cmd := exec.CommandContext(ctx, "git", verb, "--raw", rev)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	info := parseSignatureStatus(stderr.String())
+	if runErr != nil {
+		return info, fmt.Errorf("git %s %s: %w: %s", verb, rev, runErr, strings.TrimSpace(stderr.String()))
+	}
+	info.Valid = true
+	return info, nil
+}
+
+// parseSignatureStatus picks the signer, key ID and trust level out of
+// the GnuPG "status protocol" lines that `git verify-commit
+// --raw`/`git verify-tag --raw` write to stderr.
+func parseSignatureStatus(gpgStatus string) SignatureInfo {
+	var info SignatureInfo
+	for _, line := range strings.Split(gpgStatus, "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "[GNUPG:] "))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "GOODSIG":
+			if len(fields) > 1 {
+				info.KeyID = fields[1]
+			}
+			if len(fields) > 2 {
+				info.Signer = strings.Join(fields[2:], " ")
+			}
+		case "TRUST_UNDEFINED", "TRUST_NEVER", "TRUST_MARGINAL", "TRUST_FULLY", "TRUST_ULTIMATE":
+			info.Trust = strings.TrimPrefix(fields[0], "TRUST_")
+		}
+	}
+	return info
+}
+
+// configureSignatureVerification propagates the keyring and GPG/SSH
+// verification settings from conf into the working clone's git
+// config, so that `git verify-commit`/`git verify-tag` (run either by
+// us or by the user) pick them up.
+func configureSignatureVerification(ctx context.Context, dir string, conf Config) error {
+	if conf.GPGProgram != "" {
+		if err := configSet(ctx, dir, "gpg.program", conf.GPGProgram); err != nil {
+			return err
+		}
+	}
+	if conf.SSHAllowedSignersFile != "" {
+		if err := configSet(ctx, dir, "gpg.ssh.allowedSignersFile", conf.SSHAllowedSignersFile); err != nil {
+			return err
+		}
+	}
+	if conf.GPGKeyringPath != "" {
+		if err := importKeyring(ctx, dir, conf.GPGKeyringPath, conf.GPGProgram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configSet runs `git config <key> <value>` in dir.
+func configSet(ctx context.Context, dir, key, value string) error {
+	_, err := runGit(ctx, dir, "config", key, value)
+	return err
+}
+
+// importKeyring imports keyringPath into a GnuPG homedir scoped to
+// dir, and points the working clone's `gpg.program` at that homedir,
+// so verification uses only the configured keyring rather than
+// whatever happens to be in the invoking user's own GnuPG homedir.
+// Since git runs `gpg.program` as a single executable, with no shell
+// to split arguments, it is set to a wrapper script that runs program
+// (or `gpg`, if program is empty) with `--homedir`.
+func importKeyring(ctx context.Context, dir, keyringPath, program string) error {
+	homedir := filepath.Join(dir, ".flux-gnupg")
+	if err := os.MkdirAll(homedir, 0700); err != nil {
+		return err
+	}
+	if _, err := runCmd(ctx, "", "gpg", "--homedir", homedir, "--batch", "--import", keyringPath); err != nil {
+		return err
+	}
+	if program == "" {
+		program = "gpg"
+	}
+	wrapper := filepath.Join(homedir, "gpg-wrapper")
+	script := "#!/bin/sh\nexec " + program + " --homedir '" + homedir + "' \"$@\"\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0700); err != nil {
+		return err
+	}
+	return configSet(ctx, dir, "gpg.program", wrapper)
+}
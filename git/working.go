@@ -3,12 +3,17 @@ package git
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 var (
 	ErrReadOnly = errors.New("cannot make a working clone of a read-only git repo")
+	// ErrDetachedHead is returned by CommitAndPush when the checkout
+	// is on a detached CheckoutRef rather than a branch, and no
+	// PushRefSpec has been configured to say where commits should go.
+	ErrDetachedHead = errors.New("cannot push from a checkout of a ref with no configured PushRefSpec")
 )
 
 // Config holds some values we use when working in the working clone of
@@ -23,6 +28,52 @@ type Config struct {
 	SetAuthor   bool
 	SkipMessage string
 	GitSecret   bool
+
+	// Backend selects the implementation used for git operations. If
+	// nil, the package default (shelling out to `git`) is used.
+	Backend Backend
+
+	// VerifySignatures controls whether Clone checks the signature on
+	// the revision it checks out. Defaults to SignaturesNone.
+	VerifySignatures SignaturePolicy
+	// GPGKeyringPath is a GPG keyring used to verify commit/tag
+	// signatures, propagated into the working clone's git config.
+	GPGKeyringPath string
+	// GPGProgram overrides the `gpg.program` used for verification,
+	// e.g. to point at `gpgsm` or a wrapper script.
+	GPGProgram string
+	// SSHAllowedSignersFile, if set, enables verification of SSH
+	// signatures against the given allowed-signers file
+	// (`gpg.ssh.allowedSignersFile`).
+	SSHAllowedSignersFile string
+
+	// SparsePaths, if non-empty, restricts the working tree to a
+	// cone of these paths via `git sparse-checkout`, rather than
+	// populating the full tree. Essential when Paths is a small
+	// subdirectory of a much larger monorepo.
+	SparsePaths []string
+	// PartialClone, if set, makes Clone clone the working clone
+	// straight from upstream with this blob/tree filter and no
+	// checkout, instead of from the mirror, so that a sparse checkout
+	// doesn't require downloading objects outside its cone. The
+	// mirror itself is not cloned with a filter.
+	PartialClone PartialCloneMode
+
+	// CheckoutRef, if set, is checked out in place of Branch -- e.g.,
+	// "refs/changes/34/1234/5" for a Gerrit patchset, or
+	// "refs/pull/42/head" for a GitHub pull request ref. It is
+	// mutually exclusive with Branch, and results in a detached
+	// working tree rather than one tracking a branch.
+	CheckoutRef string
+	// FetchRefSpecs are additional refspecs fetched from the upstream
+	// remote before checkout, so CheckoutRef can resolve to a ref
+	// that a normal clone or mirror wouldn't otherwise have fetched.
+	FetchRefSpecs []string
+	// PushRefSpec, if set, is the destination refspec used when
+	// pushing from a checkout of CheckoutRef. Without it,
+	// CommitAndPush refuses to push from a detached checkout, since
+	// there is no branch to push to.
+	PushRefSpec string
 }
 
 // Checkout is a local working clone of the remote repo. It is
@@ -60,12 +111,31 @@ type TagAction struct {
 // the config given.
 func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	upstream := r.Origin()
-	repoDir, err := r.workingClone(ctx, conf.Branch)
-	if err != nil {
-		return nil, err
+	backend := conf.backend()
+
+	var repoDir string
+	var err error
+	if conf.PartialClone != PartialCloneNone {
+		// Bypass the usual local clone from the mirror (r.dir), and
+		// clone straight from upstream with a blob/tree filter, so a
+		// sparse checkout doesn't require every object in a large
+		// monorepo to have been fetched into the mirror first.
+		repoDir, err = os.MkdirTemp("", "flux-working")
+		if err != nil {
+			return nil, err
+		}
+		if err := backend.Clone(ctx, repoDir, upstream.URL, conf.Branch, conf.PartialClone); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+	} else {
+		repoDir, err = r.workingClone(ctx, conf.Branch)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := config(ctx, repoDir, conf.UserName, conf.UserEmail); err != nil {
+	if err := backend.SetUserConfig(ctx, repoDir, conf.UserName, conf.UserEmail); err != nil {
 		os.RemoveAll(repoDir)
 		return nil, err
 	}
@@ -86,24 +156,66 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	//
 	// NB: do this before any other fetch actions, as otherwise we may
 	// get an 'existing tag clobber' error back.
-	if err := fetch(ctx, repoDir, r.dir, `'+refs/tags/*:refs/tags/*'`); err != nil {
+	if err := backend.Fetch(ctx, repoDir, r.dir, `'+refs/tags/*:refs/tags/*'`); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
 	}
-	if err := fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
+	if err := backend.Fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
 	}
 	r.mu.RUnlock()
 
+	if len(conf.SparsePaths) > 0 {
+		if err := sparseCheckoutInit(ctx, repoDir); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+		if err := sparseCheckoutSet(ctx, repoDir, conf.SparsePaths); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+	}
+
+	if len(conf.FetchRefSpecs) > 0 {
+		if err := backend.Fetch(ctx, repoDir, upstream.URL, conf.FetchRefSpecs...); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+	}
+
+	if conf.CheckoutRef != "" {
+		if err := backend.Checkout(ctx, repoDir, conf.CheckoutRef); err != nil {
+			os.RemoveAll(repoDir)
+			return nil, err
+		}
+	}
+
 	if conf.GitSecret {
-		if err := secretUnseal(ctx, repoDir); err != nil {
+		if err := backend.SecretUnseal(ctx, repoDir); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := configureSignatureVerification(ctx, repoDir, conf); err != nil {
+		os.RemoveAll(repoDir)
+		return nil, err
+	}
+
+	if conf.VerifySignatures != "" && conf.VerifySignatures != SignaturesNone {
+		info, err := backend.VerifyRevision(ctx, repoDir, "HEAD")
+		if err != nil && conf.VerifySignatures == SignaturesRequired {
+			os.RemoveAll(repoDir)
+			return nil, fmt.Errorf("%w: %s", ErrSignatureVerificationFailed, err)
+		}
+		if err == nil && !info.Valid && conf.VerifySignatures == SignaturesRequired {
+			os.RemoveAll(repoDir)
+			return nil, fmt.Errorf("%w: HEAD signed by %q is not valid", ErrSignatureVerificationFailed, info.Signer)
+		}
+	}
+
 	return &Checkout{
 		Export:       &Export{dir: repoDir},
 		upstream:     upstream,
@@ -128,15 +240,20 @@ func (c *Checkout) AbsolutePaths() []string {
 }
 
 // CommitAndPush commits changes made in this checkout, along with any
-// extra data as a note, and pushes the commit and note to the remote repo.
+// extra data as a note, and pushes the commit and note to the remote
+// repo. The note passed here replaces whatever note already exists on
+// the commit; callers wanting an append-only history of events for a
+// revision should use AppendNoteEvent instead.
 func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction, note interface{}, addUntracked bool) error {
+	backend := c.config.backend()
+
 	if addUntracked {
-		if err := add(ctx, c.Dir(), "."); err != nil {
+		if err := backend.Add(ctx, c.Dir(), "."); err != nil {
 			return err
 		}
 	}
 
-	if !check(ctx, c.Dir(), c.config.Paths, addUntracked) {
+	if !backend.Check(ctx, c.Dir(), c.config.Paths, addUntracked) {
 		return ErrNoChanges
 	}
 
@@ -145,7 +262,7 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 		commitAction.SigningKey = c.config.SigningKey
 	}
 
-	if err := commit(ctx, c.Dir(), commitAction); err != nil {
+	if err := backend.Commit(ctx, c.Dir(), commitAction); err != nil {
 		return err
 	}
 
@@ -154,44 +271,84 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 		if err != nil {
 			return err
 		}
-		if err := addNote(ctx, c.Dir(), rev, c.config.NotesRef, note); err != nil {
+		if err := backend.AddNote(ctx, c.Dir(), rev, c.config.NotesRef, note); err != nil {
 			return err
 		}
 	}
 
-	refs := []string{c.config.Branch}
-	ok, err := refExists(ctx, c.Dir(), c.realNotesRef)
-	if ok {
-		refs = append(refs, c.realNotesRef)
-	} else if err != nil {
+	refs, err := c.pushRefSpecs(ctx)
+	if err != nil {
 		return err
 	}
 
-	if err := push(ctx, c.Dir(), c.upstream.URL, refs); err != nil {
+	if err := backend.Push(ctx, c.Dir(), c.upstream.URL, refs); err != nil {
 		return PushError(c.upstream.URL, err)
 	}
 	return nil
 }
 
+// pushRefSpecs resolves the refs CommitAndPush and RevertAndPush push:
+// the configured branch, or PushRefSpec if the checkout is a detached
+// CheckoutRef (refusing with ErrDetachedHead if neither is usable),
+// plus the notes ref, if it exists locally.
+func (c *Checkout) pushRefSpecs(ctx context.Context) ([]string, error) {
+	branchRef := c.config.Branch
+	if branchRef == "" && c.config.CheckoutRef != "" {
+		if c.config.PushRefSpec == "" {
+			return nil, ErrDetachedHead
+		}
+		branchRef = c.config.PushRefSpec
+	}
+
+	refs := []string{branchRef}
+	ok, err := refExists(ctx, c.Dir(), c.realNotesRef)
+	if ok {
+		refs = append(refs, c.realNotesRef)
+	} else if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
 // GetNote gets a note for the revision specified, or nil if there is no such note.
 func (c *Checkout) GetNote(ctx context.Context, rev string, note interface{}) (bool, error) {
-	return getNote(ctx, c.Dir(), c.realNotesRef, rev, note)
+	return c.config.backend().GetNote(ctx, c.Dir(), c.realNotesRef, rev, note)
 }
 
 func (c *Checkout) HeadRevision(ctx context.Context) (string, error) {
-	return refRevision(ctx, c.Dir(), "HEAD")
+	return c.config.backend().RefRevision(ctx, c.Dir(), "HEAD")
 }
 
+// MoveTagAndPush moves the tag named in tagAction to tagAction.Revision
+// and pushes it upstream. If the checkout has a VerifySignatures
+// policy other than SignaturesNone, the tag's signature is checked
+// with VerifyRevision afterwards, and under a SignaturesRequired
+// policy a tag that doesn't verify yields
+// ErrSignatureVerificationFailed; the tag has by then already been
+// moved and pushed.
 func (c *Checkout) MoveTagAndPush(ctx context.Context, tagAction TagAction) error {
 	if tagAction.SigningKey == "" {
 		tagAction.SigningKey = c.config.SigningKey
 	}
-	return moveTagAndPush(ctx, c.Dir(), c.upstream.URL, tagAction)
+	if err := c.config.backend().MoveTagAndPush(ctx, c.Dir(), c.upstream.URL, tagAction); err != nil {
+		return err
+	}
+
+	if c.config.VerifySignatures != "" && c.config.VerifySignatures != SignaturesNone {
+		info, err := c.VerifyRevision(ctx, tagAction.Tag)
+		if err != nil && c.config.VerifySignatures == SignaturesRequired {
+			return fmt.Errorf("%w: %s", ErrSignatureVerificationFailed, err)
+		}
+		if err == nil && !info.Valid && c.config.VerifySignatures == SignaturesRequired {
+			return fmt.Errorf("%w: tag %q signed by %q is not valid", ErrSignatureVerificationFailed, tagAction.Tag, info.Signer)
+		}
+	}
+	return nil
 }
 
 // ChangedFiles does a git diff listing changed files
 func (c *Checkout) ChangedFiles(ctx context.Context, ref string) ([]string, error) {
-	list, err := changed(ctx, c.Dir(), ref, c.config.Paths)
+	list, err := c.config.backend().ChangedFiles(ctx, c.Dir(), ref, c.config.Paths)
 	if err == nil {
 		for i, file := range list {
 			list[i] = filepath.Join(c.Dir(), file)
@@ -205,9 +362,9 @@ func (c *Checkout) NoteRevList(ctx context.Context) (map[string]struct{}, error)
 }
 
 func (c *Checkout) Checkout(ctx context.Context, rev string) error {
-	return checkout(ctx, c.Dir(), rev)
+	return c.config.backend().Checkout(ctx, c.Dir(), rev)
 }
 
 func (c *Checkout) Add(ctx context.Context, path string) error {
-	return add(ctx, c.Dir(), path)
+	return c.config.backend().Add(ctx, c.Dir(), path)
 }